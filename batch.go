@@ -0,0 +1,291 @@
+package httppipelining
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of probing a single URL with Batch.
+type Result struct {
+	URL          string
+	Available    bool
+	Latency      time.Duration
+	Attempts     int
+	Err          error
+	ServerHeader string
+}
+
+// BatchOptions configures Batch.
+type BatchOptions struct {
+	// Concurrency is the number of URLs probed at the same time.
+	// It defaults to 1 if <= 0.
+	Concurrency int
+
+	// Retries is the number of additional attempts made for a URL
+	// after a transient network error (e.g. timeout). It defaults
+	// to 0, meaning no retries.
+	Retries int
+
+	// Backoff is the delay before the first retry; it doubles after
+	// each subsequent attempt. It defaults to 0, meaning no delay.
+	Backoff time.Duration
+
+	// DialOptions are passed through to DialContext for every probe.
+	DialOptions []Option
+
+	// Prober selects the probe strategy via the registry (see
+	// RegisterProber), e.g. "options" (the default), "get:4", or
+	// "depth:6". It defaults to "options".
+	Prober string
+
+	// Timeout bounds each individual probe attempt. It defaults to 0,
+	// meaning attempts are bounded only by ctx.
+	Timeout time.Duration
+}
+
+// Batch probes urls concurrently, using a worker pool bounded by
+// opts.Concurrency, and streams a Result per URL on the returned
+// channel as each probe completes. Connections are reused across URLs
+// that share a host when possible (see connPool). The channel is
+// closed once every URL has been probed or ctx is done.
+func Batch(ctx context.Context, urls []string, opts BatchOptions) <-chan Result {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	jobs := make(chan string)
+	results := make(chan Result)
+	pool := newConnPool()
+
+	var workers sync.WaitGroup
+	workers.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer workers.Done()
+			for url := range jobs {
+				select {
+				case results <- probe(ctx, url, opts, pool):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, url := range urls {
+			select {
+			case jobs <- url:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		workers.Wait()
+		pool.closeAll()
+		close(results)
+	}()
+
+	return results
+}
+
+// probe runs a single, possibly retried, probe of url.
+func probe(ctx context.Context, url string, opts BatchOptions, pool *connPool) Result {
+	r := Result{URL: url}
+	backoff := opts.Backoff
+
+	for attempt := 1; ; attempt++ {
+		r.Attempts = attempt
+
+		attemptCtx := ctx
+		cancel := context.CancelFunc(func() {})
+		if opts.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		}
+
+		start := time.Now()
+		available, serverHeader, err := probeOnce(attemptCtx, url, opts, pool)
+		cancel()
+		r.Latency = time.Since(start)
+		r.Available = available
+		r.ServerHeader = serverHeader
+		r.Err = err
+
+		if err == nil || !isTransient(err) || attempt > opts.Retries {
+			return r
+		}
+
+		if backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				r.Err = ctx.Err()
+				return r
+			}
+			backoff *= 2
+		}
+	}
+}
+
+// probeOnce runs opts.Prober (or "options" if unset) against url,
+// reporting the Server header observed along the way, if the selected
+// prober exposes one. It reuses a pooled connection for url's host
+// when pool has one; if that connection turns out to be stale, it
+// transparently falls back to a fresh dial before giving up. A
+// connection that comes out of a successful probe is returned to pool
+// for the next caller instead of being closed.
+func probeOnce(ctx context.Context, rawurl string, opts BatchOptions, pool *connPool) (available bool, serverHeader string, err error) {
+	key, err := connKey(rawurl)
+	if err != nil {
+		return false, "", err
+	}
+
+	conn, host, reused := pool.take(key)
+	if !reused {
+		conn, host, err = DialContext(ctx, rawurl, opts.DialOptions...)
+		if err != nil {
+			return false, "", err
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := deadlineOnCancel(ctx, conn)
+	available, serverHeader, err = runProbe(conn, host, opts)
+	stop()
+
+	if err != nil && reused {
+		conn.Close()
+		conn, host, err = DialContext(ctx, rawurl, opts.DialOptions...)
+		if err != nil {
+			return false, "", err
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		stop = deadlineOnCancel(ctx, conn)
+		available, serverHeader, err = runProbe(conn, host, opts)
+		stop()
+	}
+
+	if err == nil {
+		conn.SetDeadline(time.Time{})
+		pool.put(key, conn, host)
+	} else {
+		conn.Close()
+	}
+	return available, serverHeader, err
+}
+
+// runProbe constructs opts.Prober (or "options" if unset) for host and
+// probes conn with it.
+func runProbe(conn net.Conn, host string, opts BatchOptions) (available bool, serverHeader string, err error) {
+	spec := opts.Prober
+	if spec == "" {
+		spec = "options"
+	}
+	p, err := newRegisteredProber(spec, host)
+	if err != nil {
+		return false, "", err
+	}
+
+	available, err = Probe(conn, p)
+	if sh, ok := p.(interface{ ServerHeader() string }); ok {
+		serverHeader = sh.ServerHeader()
+	}
+	return available, serverHeader, err
+}
+
+// connPool caches one idle connection per host, so Batch can reuse a
+// connection across urls that share a host instead of dialing fresh
+// for each one. It is scoped to a single Batch call.
+type connPool struct {
+	mu    sync.Mutex
+	conns map[string]pooledConn
+}
+
+type pooledConn struct {
+	conn net.Conn
+	host string
+}
+
+func newConnPool() *connPool {
+	return &connPool{conns: make(map[string]pooledConn)}
+}
+
+// take removes and returns the idle connection cached for key, if any.
+func (p *connPool) take(key string) (conn net.Conn, host string, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pc, ok := p.conns[key]
+	if !ok {
+		return nil, "", false
+	}
+	delete(p.conns, key)
+	return pc.conn, pc.host, true
+}
+
+// put caches conn as key's idle connection, closing whatever was
+// cached for key before.
+func (p *connPool) put(key string, conn net.Conn, host string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if old, ok := p.conns[key]; ok {
+		old.conn.Close()
+	}
+	p.conns[key] = pooledConn{conn: conn, host: host}
+}
+
+// closeAll closes every connection still cached in the pool.
+func (p *connPool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pc := range p.conns {
+		pc.conn.Close()
+	}
+	p.conns = nil
+}
+
+// connKey identifies the host a connection to rawurl would need to
+// reach, for indexing connPool; two URLs that differ only in path
+// share a key and can share a connection.
+func connKey(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+
+	port := u.Port()
+	switch u.Scheme {
+	case "http":
+		if port == "" {
+			port = "80"
+		}
+	case "https":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return "", fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+	return u.Scheme + "://" + net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// isTransient reports whether err is a network error worth retrying,
+// such as a timeout or a temporary condition.
+func isTransient(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout() || netErr.Temporary()
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package httppipelining
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dialerFunc adapts a function to the Dialer interface.
+type dialerFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (f dialerFunc) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f(ctx, network, addr)
+}
+
+// flakyTimeout is a net.Error that always reports itself as a timeout,
+// for simulating a transient dial failure.
+type flakyTimeout struct{}
+
+func (flakyTimeout) Error() string   { return "flaky: timeout" }
+func (flakyTimeout) Timeout() bool   { return true }
+func (flakyTimeout) Temporary() bool { return true }
+
+func TestBatch_retriesTransientDialErrors(t *testing.T) {
+	const wantFailures = 2
+
+	var attempts int32
+	dialer := dialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if atomic.AddInt32(&attempts, 1) <= wantFailures {
+			return nil, flakyTimeout{}
+		}
+		client, server := net.Pipe()
+		go serveOptions(server)
+		return client, nil
+	})
+
+	opts := BatchOptions{
+		Retries:     wantFailures + 1,
+		Backoff:     time.Millisecond,
+		DialOptions: []Option{WithDialer(dialer)},
+	}
+	results := Batch(context.Background(), []string{"http://example.test/"}, opts)
+
+	r, ok := <-results
+	if !ok {
+		t.Fatal("Batch closed its channel without a result")
+	}
+	if r.Err != nil {
+		t.Fatalf("unexpected error: %v", r.Err)
+	}
+	if !r.Available {
+		t.Error("pipelining not available")
+	}
+	if want := wantFailures + 1; r.Attempts != want {
+		t.Errorf("Attempts = %d, want %d", r.Attempts, want)
+	}
+	if got := atomic.LoadInt32(&attempts); got != int32(wantFailures+1) {
+		t.Errorf("dial called %d times, want %d", got, wantFailures+1)
+	}
+}
+
+func TestBatch_cancelUnblocksHungProbe(t *testing.T) {
+	client, server := net.Pipe()
+	t.Cleanup(func() { server.Close() })
+
+	dialer := dialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return client, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := BatchOptions{DialOptions: []Option{WithDialer(dialer)}}
+	results := Batch(ctx, []string{"http://example.test/"}, opts)
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	select {
+	case r, ok := <-results:
+		if ok && r.Err == nil {
+			t.Fatalf("expected an error from a probe unblocked by cancellation, got: %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Batch did not return within 1s of ctx being canceled")
+	}
+}
+
+// serveOptions answers the two pipelined requests an optionsProber
+// sends with the responses it expects, then closes conn.
+func serveOptions(conn net.Conn) {
+	defer conn.Close()
+	const responses = "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n" +
+		"HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n"
+	buf := make([]byte, 4096)
+	conn.Read(buf) // drain the pipelined requests before replying
+	conn.Write([]byte(responses))
+}
@@ -0,0 +1,169 @@
+package httppipelining
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http2"
+)
+
+// Caps reports which mechanisms an origin offers for getting more than
+// one request in flight over a single connection.
+type Caps struct {
+	// HTTP1Pipelining reports whether the origin answers pipelined
+	// HTTP/1.1 requests in order (see Available).
+	HTTP1Pipelining bool
+
+	// HTTP2Multiplexing reports whether, when the origin negotiates
+	// h2 via ALPN, it actually serves concurrent streams over the
+	// resulting connection.
+	HTTP2Multiplexing bool
+
+	// HTTP3 reports whether the origin advertises HTTP/3 support.
+	// Always false: detecting it requires a QUIC client, which this
+	// module doesn't implement yet.
+	HTTP3 bool
+
+	// ALPNOffered lists the application protocols, among "h2" and
+	// "http/1.1", that a TLS handshake with the origin negotiated.
+	ALPNOffered []string
+
+	// KeepAlive reports whether the origin kept a connection open
+	// across more than one request. It is inferred from the
+	// HTTP1Pipelining and HTTP2Multiplexing checks rather than probed
+	// independently, since both require a persistent connection to
+	// succeed.
+	KeepAlive bool
+}
+
+// Capabilities reports rawurl's HTTP1Pipelining, HTTP2Multiplexing,
+// ALPNOffered, and KeepAlive capabilities (see Caps). HTTP3 is always
+// false. rawurl must use the https scheme; ALPN, and therefore h2,
+// isn't negotiable over plain http.
+func Capabilities(rawurl string, opts ...Option) (Caps, error) {
+	return CapabilitiesContext(context.Background(), rawurl, opts...)
+}
+
+// CapabilitiesContext is like Capabilities, but honors ctx's deadline
+// and cancellation for every dial it performs.
+func CapabilitiesContext(ctx context.Context, rawurl string, opts ...Option) (caps Caps, err error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return caps, err
+	}
+	if u.Scheme != "https" {
+		return caps, fmt.Errorf("httppipelining: Capabilities requires https, got %q", u.Scheme)
+	}
+
+	available, err := AvailableContext(ctx, rawurl, opts...)
+	if err != nil {
+		return caps, err
+	}
+	caps.HTTP1Pipelining = available
+	caps.KeepAlive = available
+
+	caps.ALPNOffered, err = alpnOffered(ctx, rawurl, opts)
+	if err != nil {
+		return caps, err
+	}
+
+	for _, proto := range caps.ALPNOffered {
+		if proto != "h2" {
+			continue
+		}
+		mux, err := probeHTTP2Multiplexing(ctx, rawurl, opts)
+		if err != nil {
+			return caps, err
+		}
+		caps.HTTP2Multiplexing = mux
+		caps.KeepAlive = caps.KeepAlive || mux
+	}
+
+	return caps, nil
+}
+
+// alpnCandidates are the protocols alpnOffered checks for, one at a
+// time, since TLS's ALPN extension only reveals the single protocol a
+// server picked from whatever the client offered.
+var alpnCandidates = []string{"h2", "http/1.1"}
+
+// alpnOffered dials rawurl once per entry in alpnCandidates, each time
+// offering only that protocol via ALPN, and reports which ones the
+// server accepted.
+func alpnOffered(ctx context.Context, rawurl string, opts []Option) (offered []string, err error) {
+	for _, proto := range alpnCandidates {
+		cfg := &tls.Config{NextProtos: []string{proto}}
+		negotiated, err := negotiateALPN(ctx, rawurl, cfg, opts)
+		if err != nil {
+			continue // server rejected or doesn't support proto
+		}
+		if negotiated == proto {
+			offered = append(offered, proto)
+		}
+	}
+	return offered, nil
+}
+
+// negotiateALPN dials rawurl with cfg's NextProtos and returns the
+// protocol the server's TLS handshake negotiated.
+func negotiateALPN(ctx context.Context, rawurl string, cfg *tls.Config, opts []Option) (string, error) {
+	dialOpts := append(append([]Option(nil), opts...), WithTLSConfig(cfg))
+	conn, _, err := DialContext(ctx, rawurl, dialOpts...)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return "", fmt.Errorf("httppipelining: %s did not negotiate TLS", rawurl)
+	}
+	return tlsConn.ConnectionState().NegotiatedProtocol, nil
+}
+
+// probeHTTP2Multiplexing dials rawurl, negotiates h2 via ALPN, and
+// issues two concurrent requests over the resulting connection,
+// reporting true if both complete successfully. It does not check
+// whether the server handled the two streams at the same time or one
+// after the other.
+func probeHTTP2Multiplexing(ctx context.Context, rawurl string, opts []Option) (bool, error) {
+	cfg := &tls.Config{NextProtos: []string{"h2"}}
+	dialOpts := append(append([]Option(nil), opts...), WithTLSConfig(cfg))
+	conn, host, err := DialContext(ctx, rawurl, dialOpts...)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	t := &http2.Transport{}
+	cc, err := t.NewClientConn(conn)
+	if err != nil {
+		return false, err
+	}
+
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			req, err := http.NewRequestWithContext(ctx, "GET", "https://"+host+"/", nil)
+			if err != nil {
+				results <- err
+				return
+			}
+			resp, err := cc.RoundTrip(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			results <- err
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,17 @@
+package httppipelining
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCapabilitiesContext_requiresHTTPS(t *testing.T) {
+	_, err := CapabilitiesContext(context.Background(), "http://example.com/")
+	if err == nil {
+		t.Fatal("expected an error for a non-https URL")
+	}
+	if !strings.Contains(err.Error(), "https") {
+		t.Errorf("error = %q, want it to mention https", err)
+	}
+}
@@ -0,0 +1,179 @@
+// Command httppipelining sweeps a list of URLs and reports whether each
+// one supports HTTP/1.1 pipelining.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dwlnetnl/httppipelining"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run implements the CLI and returns the process exit code, so tests
+// can drive it without forking a subprocess: 0 if every URL was
+// probed and reported available, 1 on any unavailable/error result or
+// I/O failure, 2 on a flag-parsing error.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("httppipelining", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("f", "", "read URLs from file instead of stdin")
+	format := fs.String("format", "jsonl", `output format: "jsonl" or "csv"`)
+	concurrency := fs.Int("concurrency", 1, "number of URLs probed at the same time")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for each probe attempt")
+	prober := fs.String("prober", "options", `probe strategy, e.g. "options", "get:4", "head", or "depth:6"`)
+	proxy := fs.String("proxy", "", "HTTP proxy (host:port) to dial through")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	urls, err := readURLs(*file, stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, "httppipelining:", err)
+		return 1
+	}
+
+	var writeResult func(outcome) error
+	switch *format {
+	case "jsonl":
+		writeResult = jsonlWriter(stdout)
+	case "csv":
+		writeResult = csvWriter(stdout)
+	default:
+		fmt.Fprintf(stderr, "httppipelining: unknown -format %q\n", *format)
+		return 2
+	}
+
+	var dialOpts []httppipelining.Option
+	if *proxy != "" {
+		dialer := &httppipelining.HTTPProxyDialer{ProxyAddr: *proxy}
+		dialOpts = append(dialOpts, httppipelining.WithDialer(dialer))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results := httppipelining.Batch(ctx, urls, httppipelining.BatchOptions{
+		Concurrency: *concurrency,
+		Timeout:     *timeout,
+		Prober:      *prober,
+		DialOptions: dialOpts,
+	})
+
+	failed := false
+	probed := 0
+	for r := range results {
+		probed++
+		if r.Err != nil || !r.Available {
+			failed = true
+		}
+		if err := writeResult(toOutcome(r)); err != nil {
+			fmt.Fprintln(stderr, "httppipelining:", err)
+			return 1
+		}
+	}
+
+	if failed || probed < len(urls) {
+		return 1
+	}
+	return 0
+}
+
+// readURLs reads one URL per non-blank line from path, or from stdin
+// if path is empty.
+func readURLs(path string, stdin io.Reader) ([]string, error) {
+	r := stdin
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var urls []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, sc.Err()
+}
+
+// outcome is the serialized form of a httppipelining.Result.
+type outcome struct {
+	URL          string `json:"url"`
+	Available    bool   `json:"available"`
+	LatencyMS    int64  `json:"latency_ms"`
+	Attempts     int    `json:"attempts"`
+	ServerHeader string `json:"server_header,omitempty"`
+	Err          string `json:"error,omitempty"`
+}
+
+func toOutcome(r httppipelining.Result) outcome {
+	o := outcome{
+		URL:          r.URL,
+		Available:    r.Available,
+		LatencyMS:    r.Latency.Milliseconds(),
+		Attempts:     r.Attempts,
+		ServerHeader: r.ServerHeader,
+	}
+	if r.Err != nil {
+		o.Err = r.Err.Error()
+	}
+	return o
+}
+
+// jsonlWriter returns a writeResult func that emits one JSON object
+// per line to w.
+func jsonlWriter(w io.Writer) func(outcome) error {
+	enc := json.NewEncoder(w)
+	return func(o outcome) error { return enc.Encode(o) }
+}
+
+// csvWriter returns a writeResult func that emits o as CSV rows to w,
+// writing a header row on the first call.
+func csvWriter(w io.Writer) func(outcome) error {
+	cw := csv.NewWriter(w)
+	header := []string{"url", "available", "latency_ms", "attempts", "server_header", "error"}
+	wrote := false
+
+	return func(o outcome) error {
+		if !wrote {
+			if err := cw.Write(header); err != nil {
+				return err
+			}
+			wrote = true
+		}
+		row := []string{
+			o.URL,
+			strconv.FormatBool(o.Available),
+			strconv.FormatInt(o.LatencyMS, 10),
+			strconv.Itoa(o.Attempts),
+			o.ServerHeader,
+			o.Err,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+}
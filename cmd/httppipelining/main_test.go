@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dwlnetnl/httppipelining"
+)
+
+// serveAlways200 starts a raw listener that answers every request on
+// every connection with "200 OK", regardless of what was asked for.
+// That makes the options prober's second request (which expects 400)
+// read as a clean, errorless "not available" result; an
+// httptest.Server can't produce this, since net/http's server
+// special-cases "OPTIONS *" before any handler sees it.
+func serveAlways200(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					if _, err := br.ReadString('\n'); err != nil {
+						return
+					}
+					for {
+						h, err := br.ReadString('\n')
+						if err != nil || h == "\r\n" || h == "\n" {
+							break
+						}
+					}
+					fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")
+				}
+			}()
+		}
+	}()
+
+	return "http://" + ln.Addr().String() + "/"
+}
+
+func TestRun_exitCode(t *testing.T) {
+	available := httptest.NewServer(nil)
+	t.Cleanup(available.Close)
+
+	unavailable := serveAlways200(t)
+
+	tests := []struct {
+		name string
+		urls string
+		want int
+	}{
+		{"available", available.URL + "\n", 0},
+		{"unavailable", unavailable + "\n", 1},
+		{"mixed", available.URL + "\n" + unavailable + "\n", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			got := run(nil, strings.NewReader(tt.urls), &stdout, &stderr)
+			if got != tt.want {
+				t.Errorf("run() = %d, want %d (stderr: %s)", got, tt.want, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRun_unknownFormat(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	got := run([]string{"-format", "xml"}, strings.NewReader(""), &stdout, &stderr)
+	if got != 2 {
+		t.Errorf("run() = %d, want 2", got)
+	}
+	if !strings.Contains(stderr.String(), `unknown -format "xml"`) {
+		t.Errorf("stderr = %q, want it to mention the unknown format", stderr.String())
+	}
+}
+
+func TestToOutcome(t *testing.T) {
+	o := toOutcome(httppipelining.Result{
+		URL:       "http://example.com",
+		Available: true,
+		Latency:   1500 * time.Millisecond,
+		Attempts:  2,
+		Err:       errors.New("boom"),
+	})
+	want := outcome{URL: "http://example.com", Available: true, LatencyMS: 1500, Attempts: 2, Err: "boom"}
+	if o != want {
+		t.Errorf("toOutcome() = %+v, want %+v", o, want)
+	}
+}
+
+func TestJsonlWriter(t *testing.T) {
+	var buf bytes.Buffer
+	write := jsonlWriter(&buf)
+	if err := write(outcome{URL: "http://example.com", Available: true, Attempts: 1}); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"url":"http://example.com","available":true,"latency_ms":0,"attempts":1}` + "\n"
+	if buf.String() != want {
+		t.Errorf("jsonlWriter wrote %q, want %q", buf.String(), want)
+	}
+}
+
+func TestCsvWriter(t *testing.T) {
+	var buf bytes.Buffer
+	write := csvWriter(&buf)
+	if err := write(outcome{URL: "http://example.com", Available: true, Attempts: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(outcome{URL: "http://example.org", Err: "boom"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "url,available,latency_ms,attempts,server_header,error\n" +
+		"http://example.com,true,0,1,,\n" +
+		"http://example.org,false,0,0,,boom\n"
+	if buf.String() != want {
+		t.Errorf("csvWriter wrote %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,44 @@
+package httppipelining
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestDialContext_usesConfiguredDialer(t *testing.T) {
+	var gotNetwork, gotAddr string
+	client, server := net.Pipe()
+	server.Close()
+
+	dialer := dialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		gotNetwork, gotAddr = network, addr
+		return client, nil
+	})
+
+	conn, host, err := DialContext(context.Background(), "http://example.com:8080/", WithDialer(dialer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if host != "example.com" {
+		t.Errorf("host = %q, want %q", host, "example.com")
+	}
+	if gotNetwork != "tcp" {
+		t.Errorf("network = %q, want %q", gotNetwork, "tcp")
+	}
+	if gotAddr != "example.com:8080" {
+		t.Errorf("addr = %q, want %q", gotAddr, "example.com:8080")
+	}
+	if conn != client {
+		t.Error("DialContext did not return the configured Dialer's connection")
+	}
+}
+
+func TestDialContext_unsupportedScheme(t *testing.T) {
+	_, _, err := DialContext(context.Background(), "ftp://example.com/")
+	if err == nil {
+		t.Fatal("expected an error for an unsupported scheme")
+	}
+}
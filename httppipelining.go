@@ -4,18 +4,25 @@ package httppipelining
 
 import (
 	"bufio"
-	"bytes"
+	"context"
 	"crypto/tls"
-	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"net/url"
+	"time"
 )
 
 // Available checks if HTTP pipelining is available.
 func Available(rawurl string) (bool, error) {
-	conn, host, err := Dial(rawurl)
+	return AvailableContext(context.Background(), rawurl)
+}
+
+// AvailableContext checks if HTTP pipelining is available, using ctx to
+// control the dial and honoring opts (see DialContext).
+func AvailableContext(ctx context.Context, rawurl string, opts ...Option) (bool, error) {
+	conn, host, err := DialContext(ctx, rawurl, opts...)
 	if err != nil {
 		return false, err
 	}
@@ -23,14 +30,61 @@ func Available(rawurl string) (bool, error) {
 	return Supported(conn, host)
 }
 
+// Dialer dials network connections. It is implemented by *net.Dialer and
+// can be implemented to route connections through HTTP or SOCKS proxies.
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Option configures DialContext (and AvailableContext, which delegates
+// to it).
+type Option func(*dialOptions)
+
+type dialOptions struct {
+	dialer    Dialer
+	tlsConfig *tls.Config
+}
+
+// WithDialer sets the Dialer used to establish the underlying TCP
+// connection, e.g. to dial through an HTTP or SOCKS proxy. The default
+// is a plain *net.Dialer.
+func WithDialer(d Dialer) Option {
+	return func(o *dialOptions) { o.dialer = d }
+}
+
+// WithTLSConfig sets the tls.Config used for https:// targets. If
+// ServerName is empty it is set to the target host, so SNI-strict
+// servers are handled correctly. Set NextProtos to []string{"http/1.1"}
+// to offer that ALPN value during the handshake; a server that
+// negotiates no ALPN protocol is still accepted.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *dialOptions) { o.tlsConfig = cfg }
+}
+
 // Dial dials a HTTP server and returns the connection.
 // The host name is returned for use in the Host header.
 func Dial(rawurl string) (conn net.Conn, host string, err error) {
+	return DialContext(context.Background(), rawurl)
+}
+
+// DialContext dials a HTTP server like Dial, but respects ctx's deadline
+// and cancellation, and accepts Options to customize TLS and proxy
+// dialing.
+func DialContext(ctx context.Context, rawurl string, opts ...Option) (conn net.Conn, host string, err error) {
 	url, err := url.Parse(rawurl)
 	if err != nil {
 		return nil, "", err
 	}
 
+	var o dialOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	dialer := o.dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
 	host = url.Hostname()
 	port := url.Port()
 	switch url.Scheme {
@@ -39,13 +93,16 @@ func Dial(rawurl string) (conn net.Conn, host string, err error) {
 			port = "80"
 		}
 		addr := net.JoinHostPort(host, port)
-		conn, err = net.Dial("tcp", addr)
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
 	case "https":
 		if port == "" {
 			port = "443"
 		}
 		addr := net.JoinHostPort(host, port)
-		conn, err = tls.Dial("tcp", addr, nil)
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			conn, err = tlsClientHandshake(ctx, conn, host, o.tlsConfig)
+		}
 	default:
 		err = fmt.Errorf("unsupported scheme: %s", url.Scheme)
 	}
@@ -53,13 +110,64 @@ func Dial(rawurl string) (conn net.Conn, host string, err error) {
 	return conn, host, err
 }
 
+// tlsClientHandshake wraps conn in a TLS client connection and performs
+// the handshake, aborting early if ctx is done.
+func tlsClientHandshake(ctx context.Context, conn net.Conn, host string, cfg *tls.Config) (net.Conn, error) {
+	if cfg == nil {
+		cfg = &tls.Config{}
+	} else {
+		cfg = cfg.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if deadline, ok := ctx.Deadline(); ok {
+		tlsConn.SetDeadline(deadline)
+		defer tlsConn.SetDeadline(time.Time{})
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- tlsConn.Handshake() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	case <-ctx.Done():
+		conn.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// deadlineOnCancel starts a goroutine that forces conn's deadline into
+// the past as soon as ctx is done, unblocking any read or write
+// already in flight on conn; plain (non-deadline) cancellation
+// otherwise has no way to interrupt one. The caller must call the
+// returned stop func once it's done using conn for ctx, to release
+// the goroutine.
+func deadlineOnCancel(ctx context.Context, conn net.Conn) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
 // Supported checks if connection rw supports HTTP pipelining.
 // Host is required and used in the Host header.
 func Supported(rw io.ReadWriter, host string) (bool, error) {
 	if host == "" {
 		panic("host is empty")
 	}
-	return Probe(rw, &optionsProber{host})
+	return Probe(rw, &optionsProber{host: host})
 }
 
 // Prober probes a connection for HTTP pipelining support.
@@ -70,10 +178,15 @@ type Prober interface {
 	// WriteRequest writes a probe request.
 	WriteRequest(id uint, w *bufio.Writer) error
 
-	// ReadRequest reads a probe request and checks if
-	// it is the expected answer for the corresponding
-	// request. This asserts the pipeline ordering.
-	ReadRequest(id uint, r *bufio.Reader) (expected bool, err error)
+	// RequestMethod returns the HTTP method used for request id's
+	// probe request, so its response is parsed correctly (e.g. a HEAD
+	// response carries no body despite any Content-Length header).
+	RequestMethod(id uint) string
+
+	// ReadRequest checks if resp is the expected answer for the
+	// corresponding request. This asserts the pipeline ordering.
+	// Probe drains and closes resp.Body after ReadRequest returns.
+	ReadRequest(id uint, resp *http.Response) (expected bool, err error)
 }
 
 // Probe probes connection rw for HTTP pipelining support.
@@ -106,7 +219,19 @@ func Probe(rw io.ReadWriter, p Prober) (available bool, err error) {
 		if w.err != nil {
 			return false, w.err
 		}
-		expected, err := p.ReadRequest(w.id, br)
+
+		req := &http.Request{Method: p.RequestMethod(w.id)}
+		resp, err := http.ReadResponse(br, req)
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("malformed response: %w (id=%d)", err, w.id)
+		}
+
+		expected, err := p.ReadRequest(w.id, resp)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
 		if err != nil {
 			return false, err
 		}
@@ -118,6 +243,8 @@ func Probe(rw io.ReadWriter, p Prober) (available bool, err error) {
 
 type optionsProber struct {
 	host string
+
+	serverHeader string
 }
 
 var _ Prober = (*optionsProber)(nil)
@@ -137,70 +264,25 @@ func (p *optionsProber) WriteRequest(id uint, w *bufio.Writer) (err error) {
 	return err
 }
 
-func (p *optionsProber) ReadRequest(id uint, r *bufio.Reader) (expected bool, err error) {
+func (p *optionsProber) RequestMethod(id uint) string { return "OPTIONS" }
+
+func (p *optionsProber) ReadRequest(id uint, resp *http.Response) (expected bool, err error) {
 	if id >= 2 {
 		panic(fmt.Sprintf("invalid id: %d", id))
 	}
-	code, err := parseStatus(r)
-	if err == io.EOF {
-		return false, nil
-	}
-	if err != nil {
-		return false, fmt.Errorf("malformed request: %w (id=%d)", err, id)
+	if id == 0 {
+		p.serverHeader = resp.Header.Get("Server")
 	}
 	switch id {
 	case 0:
-		expected = (code == 200)
+		expected = resp.StatusCode == 200
 	case 1:
-		expected = (code == 400)
+		expected = resp.StatusCode == 400
 	}
 	return expected, nil
 }
 
-func parseStatus(r *bufio.Reader) (status int, err error) {
-	line, err := r.ReadString('\n')
-	if err != nil {
-		return 0, err
-	}
-	n, err := fmt.Sscanf(line, "HTTP/1.1 %d", &status)
-	if err != nil {
-		return 0, err
-	}
-	if n != 1 {
-		return 0, errors.New("malformed status line")
-	}
-
-	var contentLength int
-	lengthFound := false
-	for {
-		line, err := r.ReadSlice('\n')
-		if err != nil {
-			return 0, err
-		}
-
-		if len(line) == 2 && line[0] == '\r' && line[1] == '\n' {
-			break
-		}
-		if lengthFound || line[0] != 'C' && line[0] != 'c' {
-			continue
-		}
-
-		lower := bytes.ToLower(line)
-		if bytes.HasPrefix(lower, []byte("content-length:")) {
-			value := string(lower[len("content-length:"):])
-			n, err := fmt.Sscanf(value, "%d\r\n", &contentLength)
-			if err != nil {
-				return 0, err
-			}
-			if n != 1 {
-				return 0, fmt.Errorf("no content length")
-			}
-			lengthFound = true
-		}
-	}
-	if _, err := r.Discard(contentLength); err != nil {
-		return 0, err
-	}
-
-	return status, nil
-}
+// ServerHeader returns the Server header seen in the first probe
+// response, or "" if none was sent. It is used by Batch to populate
+// Result.ServerHeader.
+func (p *optionsProber) ServerHeader() string { return p.serverHeader }
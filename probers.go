@@ -0,0 +1,217 @@
+package httppipelining
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// methodProber pipelines n requests of method to host, alternating
+// between the root resource (expected to succeed) and a path that is
+// expected to 404, to assert that responses come back in the order
+// they were written.
+type methodProber struct {
+	method string
+	host   string
+	n      uint
+}
+
+var _ Prober = (*methodProber)(nil)
+
+// GETProber returns a Prober that pipelines n GET requests to host,
+// alternating between "/" and a path expected to 404. If n is 0, it
+// defaults to 2, matching the default OPTIONS probe.
+func GETProber(host string, n uint) Prober {
+	if n == 0 {
+		n = 2
+	}
+	return &methodProber{method: "GET", host: host, n: n}
+}
+
+// HEADProber returns a Prober like GETProber, but using HEAD requests.
+// Some servers special-case OPTIONS and reject it, while still
+// honoring pipelined HEAD requests.
+func HEADProber(host string, n uint) Prober {
+	if n == 0 {
+		n = 2
+	}
+	return &methodProber{method: "HEAD", host: host, n: n}
+}
+
+func (p *methodProber) NumRequests() uint { return p.n }
+
+func (p *methodProber) WriteRequest(id uint, w *bufio.Writer) (err error) {
+	if id >= p.n {
+		panic(fmt.Sprintf("invalid id: %d", id))
+	}
+	path := "/"
+	if id%2 == 1 {
+		path = "/httppipelining-probe-404"
+	}
+	_, err = fmt.Fprintf(w, "%s %s HTTP/1.1\r\nHost: %s\r\n\r\n", p.method, path, p.host)
+	return err
+}
+
+func (p *methodProber) RequestMethod(id uint) string { return p.method }
+
+func (p *methodProber) ReadRequest(id uint, resp *http.Response) (expected bool, err error) {
+	if id >= p.n {
+		panic(fmt.Sprintf("invalid id: %d", id))
+	}
+	if id%2 == 0 {
+		expected = resp.StatusCode < 400
+	} else {
+		expected = resp.StatusCode == 404
+	}
+	return expected, nil
+}
+
+// depthResources are static resources most origins serve without
+// dynamic processing, used by DepthProber to probe distinct paths.
+var depthResources = []string{"/robots.txt", "/favicon.ico", "/", "/index.html"}
+
+// depthProber pipelines n GET requests across depthResources,
+// alternating with paths expected to 404, to assert ordering across a
+// wider variety of resources than methodProber.
+type depthProber struct {
+	host string
+	n    uint
+}
+
+var _ Prober = (*depthProber)(nil)
+
+// DepthProber returns a Prober that pipelines n idempotent GET
+// requests to distinct static resources (cycling through
+// depthResources) and verifies the responses are read back in the
+// order they were written. If n is 0, it defaults to 4.
+func DepthProber(host string, n uint) Prober {
+	if n == 0 {
+		n = 4
+	}
+	return &depthProber{host: host, n: n}
+}
+
+func (p *depthProber) NumRequests() uint { return p.n }
+
+func (p *depthProber) path(id uint) string {
+	if id%2 == 0 {
+		return depthResources[int(id/2)%len(depthResources)]
+	}
+	return fmt.Sprintf("/httppipelining-probe-404-%d", id)
+}
+
+func (p *depthProber) WriteRequest(id uint, w *bufio.Writer) (err error) {
+	if id >= p.n {
+		panic(fmt.Sprintf("invalid id: %d", id))
+	}
+	_, err = fmt.Fprintf(w, "GET %s HTTP/1.1\r\nHost: %s\r\n\r\n", p.path(id), p.host)
+	return err
+}
+
+func (p *depthProber) RequestMethod(id uint) string { return "GET" }
+
+func (p *depthProber) ReadRequest(id uint, resp *http.Response) (expected bool, err error) {
+	if id >= p.n {
+		panic(fmt.Sprintf("invalid id: %d", id))
+	}
+	if id%2 == 0 {
+		expected = resp.StatusCode < 400
+	} else {
+		expected = resp.StatusCode == 404
+	}
+	return expected, nil
+}
+
+// ProberFactory constructs a Prober for host. n is the pipeline depth
+// requested via AvailableWith (e.g. the 4 in "get:4"); factories for
+// probers with a fixed request count, like "options", ignore it.
+type ProberFactory func(host string, n uint) Prober
+
+var (
+	proberMu       sync.RWMutex
+	proberRegistry = map[string]ProberFactory{
+		"options": func(host string, _ uint) Prober { return &optionsProber{host: host} },
+		"get":     GETProber,
+		"head":    HEADProber,
+		"depth":   DepthProber,
+	}
+)
+
+// RegisterProber registers factory under name, so it can be selected
+// via AvailableWith(ctx, rawurl, name). Registering under an existing
+// name replaces it, which built-in names ("options", "get", "head",
+// "depth") also allow.
+func RegisterProber(name string, factory ProberFactory) {
+	proberMu.Lock()
+	defer proberMu.Unlock()
+	proberRegistry[name] = factory
+}
+
+// AvailableWith checks if HTTP pipelining is available using the named
+// Prober from the registry, e.g. "options" (the default used by
+// Available), "get", "get:4" (4 pipelined GET requests), "head", or
+// "depth:6".
+func AvailableWith(ctx context.Context, rawurl, name string, opts ...Option) (bool, error) {
+	conn, host, err := DialContext(ctx, rawurl, opts...)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	p, err := newRegisteredProber(name, host)
+	if err != nil {
+		return false, err
+	}
+	return Probe(conn, p)
+}
+
+func newRegisteredProber(spec, host string) (Prober, error) {
+	name, n, err := parseProberSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	proberMu.RLock()
+	factory, ok := proberRegistry[name]
+	proberMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("httppipelining: unknown prober %q", name)
+	}
+	return factory(host, n), nil
+}
+
+// parseProberSpec splits a "name" or "name:n" spec into its name and
+// optional pipeline depth.
+func parseProberSpec(spec string) (name string, n uint, err error) {
+	name = spec
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		name = spec[:i]
+		v, err := strconv.ParseUint(spec[i+1:], 10, 0)
+		if err != nil {
+			return "", 0, fmt.Errorf("httppipelining: invalid prober spec %q: %w", spec, err)
+		}
+		n = uint(v)
+	}
+	return name, n, nil
+}
+
+// CompositeProber dials rawurl fresh for each named prober in names, in
+// order, and returns the result of the first one that completes
+// without error and finds pipelining available. This suits origins
+// that reject some probe strategies outright (e.g. disabling OPTIONS)
+// but honor others, which usually shows up as a clean "not available"
+// result rather than an error. If every prober errors or reports
+// unavailable, it returns the last one's result.
+func CompositeProber(ctx context.Context, rawurl string, names []string, opts ...Option) (available bool, err error) {
+	for _, name := range names {
+		available, err = AvailableWith(ctx, rawurl, name, opts...)
+		if err == nil && available {
+			return true, nil
+		}
+	}
+	return available, err
+}
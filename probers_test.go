@@ -0,0 +1,94 @@
+package httppipelining
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+)
+
+// serveStatusByPath starts a listener that answers every request on
+// every connection it accepts with a status chosen by method and
+// path, and returns its address. It stops when the test ends.
+func serveStatusByPath(t *testing.T, status func(method, path string) int) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveRequests(conn, status)
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// serveRequests answers every pipelined request line read from conn
+// with a canned, empty-bodied response until the connection closes.
+func serveRequests(conn net.Conn, status func(method, path string) int) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
+		}
+		var method, path string
+		if _, err := fmt.Sscanf(line, "%s %s", &method, &path); err != nil {
+			return
+		}
+		for {
+			h, err := br.ReadString('\n')
+			if err != nil || h == "\r\n" || h == "\n" {
+				break
+			}
+		}
+		fmt.Fprintf(conn, "HTTP/1.1 %d OK\r\nContent-Length: 0\r\n\r\n", status(method, path))
+	}
+}
+
+func TestCompositeProber_fallsBackPastCleanUnavailable(t *testing.T) {
+	// The OPTIONS probe always gets 200, so its second request (which
+	// expects 400) reads as a clean, errorless "not available". The
+	// GET probe gets the status its requests actually expect.
+	addr := serveStatusByPath(t, func(method, path string) int {
+		switch {
+		case method == "OPTIONS":
+			return 200
+		case path == "/httppipelining-probe-404":
+			return 404
+		default:
+			return 200
+		}
+	})
+
+	available, err := CompositeProber(context.Background(), "http://"+addr+"/", []string{"options", "get"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("CompositeProber did not fall back to the get prober after options reported unavailable")
+	}
+}
+
+func TestCompositeProber_allUnavailable(t *testing.T) {
+	addr := serveStatusByPath(t, func(method, path string) int { return 200 })
+
+	available, err := CompositeProber(context.Background(), "http://"+addr+"/", []string{"options", "get"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available {
+		t.Error("expected CompositeProber to report unavailable when no prober succeeds")
+	}
+}
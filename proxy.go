@@ -0,0 +1,82 @@
+package httppipelining
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPProxyDialer dials addr by issuing an HTTP CONNECT request to a
+// proxy, for traversing corporate HTTP proxies that don't support
+// transparent tunneling.
+type HTTPProxyDialer struct {
+	// ProxyAddr is the proxy's host:port.
+	ProxyAddr string
+
+	// Dialer dials the connection to the proxy itself. It defaults to
+	// a plain *net.Dialer.
+	Dialer Dialer
+}
+
+var _ Dialer = (*HTTPProxyDialer)(nil)
+
+// DialContext dials the proxy and asks it to CONNECT to addr,
+// returning the tunneled connection once the proxy confirms it.
+func (d *HTTPProxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	conn, err := dialer.DialContext(ctx, network, d.ProxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	defer conn.SetDeadline(time.Time{})
+	stop := deadlineOnCancel(ctx, conn)
+	defer stop()
+
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("httppipelining: proxy CONNECT to %s via %s: %s", addr, d.ProxyAddr, resp.Status)
+	}
+
+	// br may have buffered bytes belonging to the tunneled stream
+	// past the CONNECT response; route reads through it so none are
+	// lost.
+	return &bufferedConn{Conn: conn, r: br}, nil
+}
+
+// bufferedConn drains r before falling through to Conn's reads, so
+// bytes buffered while parsing an HTTP response aren't dropped.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
@@ -0,0 +1,131 @@
+package httppipelining
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeProxy starts a listener that accepts a single connection,
+// expects a CONNECT request, and replies with status. If status is
+// http.StatusOK, it then writes extra after the response headers (to
+// exercise bufferedConn's draining of bytes read past the CONNECT
+// response) and echoes back the next len(extra) bytes it reads.
+func fakeProxy(t *testing.T, status int, extra string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil || req.Method != "CONNECT" {
+			return
+		}
+
+		if status == http.StatusOK {
+			conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n" + extra))
+			buf := make([]byte, len(extra))
+			io.ReadFull(conn, buf)
+			conn.Write(buf)
+		} else {
+			conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n"))
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestHTTPProxyDialer_tunnels(t *testing.T) {
+	const extra = "leftover"
+	proxyAddr := fakeProxy(t, http.StatusOK, extra)
+
+	d := &HTTPProxyDialer{ProxyAddr: proxyAddr}
+	conn, err := d.DialContext(context.Background(), "tcp", "example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, len(extra))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != extra {
+		t.Errorf("read %q, want the bytes buffered past the CONNECT response %q", buf, extra)
+	}
+
+	echoed := make([]byte, len(extra))
+	if _, err := conn.Write([]byte(extra)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(conn, echoed); err != nil {
+		t.Fatal(err)
+	}
+	if string(echoed) != extra {
+		t.Errorf("echo = %q, want %q", echoed, extra)
+	}
+}
+
+func TestHTTPProxyDialer_cancelUnblocksHungProxy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Read the CONNECT request but never reply, to simulate a
+		// proxy that hangs.
+		bufio.NewReader(conn).ReadString('\n')
+		select {}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	d := &HTTPProxyDialer{ProxyAddr: ln.Addr().String()}
+	done := make(chan error, 1)
+	go func() {
+		_, err := d.DialContext(ctx, "tcp", "example.com:80")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected an error from a dial unblocked by cancellation")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("DialContext did not return within 1s of ctx being canceled")
+	}
+}
+
+func TestHTTPProxyDialer_rejectsNonOK(t *testing.T) {
+	proxyAddr := fakeProxy(t, http.StatusBadGateway, "")
+
+	d := &HTTPProxyDialer{ProxyAddr: proxyAddr}
+	_, err := d.DialContext(context.Background(), "tcp", "example.com:80")
+	if err == nil {
+		t.Fatal("expected an error for a non-200 CONNECT response")
+	}
+}